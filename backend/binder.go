@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// validate is a single, reusable validator instance — the package docs
+// recommend caching it since it builds a struct-tag cache on first use.
+var validate = validator.New()
+
+// FieldError describes one failed validation rule in a request body, in
+// the shape clients can render directly next to the offending field.
+type FieldError struct {
+	Field string `json:"field" xml:"field"`
+	Rule  string `json:"rule" xml:"rule"`
+}
+
+// ValidationErrorResponse is returned instead of a bare ErrorResponse
+// when a bound request fails struct validation.
+type ValidationErrorResponse struct {
+	Error  string       `json:"error" xml:"error"`
+	Fields []FieldError `json:"fields" xml:"fields>field"`
+}
+
+// Bind decodes a request body (or, for GET, its query params) into v based
+// on Content-Type, then runs struct validation. Modeled on Echo's
+// DefaultBinder: JSON, XML, and form-encoded bodies all land in the same
+// destination struct so handlers don't need per-content-type branches.
+func Bind(r *http.Request, v interface{}) error {
+	if r.Method == http.MethodGet {
+		if err := bindQuery(r, v); err != nil {
+			return err
+		}
+		return validate.Struct(v)
+	}
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		contentType = "application/json"
+	}
+
+	switch {
+	case contentType == "application/json" || contentType == "":
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+			return fmt.Errorf("invalid JSON body: %w", err)
+		}
+	case contentType == "application/xml" || contentType == "text/xml":
+		if err := xml.NewDecoder(r.Body).Decode(v); err != nil {
+			return fmt.Errorf("invalid XML body: %w", err)
+		}
+	case contentType == "application/x-www-form-urlencoded" || contentType == "multipart/form-data":
+		if contentType == "multipart/form-data" {
+			if err := r.ParseMultipartForm(32 << 20); err != nil {
+				return fmt.Errorf("invalid multipart form: %w", err)
+			}
+		} else if err := r.ParseForm(); err != nil {
+			return fmt.Errorf("invalid form body: %w", err)
+		}
+		if err := bindForm(r.PostForm, v); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported content type: %s", contentType)
+	}
+
+	return validate.Struct(v)
+}
+
+// bindQuery and bindForm both populate TravelPlanRequest from a
+// url.Values, which is all either a GET query string or a form body is.
+func bindQuery(r *http.Request, v interface{}) error {
+	return bindForm(r.URL.Query(), v)
+}
+
+func bindForm(values map[string][]string, v interface{}) error {
+	req, ok := v.(*TravelPlanRequest)
+	if !ok {
+		return fmt.Errorf("form/query binding is only supported for TravelPlanRequest")
+	}
+
+	if vals, ok := values["source"]; ok && len(vals) > 0 {
+		req.Source = vals[0]
+	}
+	if vals, ok := values["destination"]; ok && len(vals) > 0 {
+		req.Destination = vals[0]
+	}
+	if vals, ok := values["budget"]; ok && len(vals) > 0 {
+		budget, err := strconv.ParseFloat(vals[0], 64)
+		if err != nil {
+			return fmt.Errorf("invalid budget: %w", err)
+		}
+		req.Budget = budget
+	}
+	return nil
+}
+
+// fieldErrorsFrom converts a validator.ValidationErrors into our
+// client-facing FieldError shape.
+func fieldErrorsFrom(err error) []FieldError {
+	verrs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return nil
+	}
+	fields := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		fields = append(fields, FieldError{Field: fe.Field(), Rule: fe.Tag()})
+	}
+	return fields
+}
+
+// --- CONTENT-NEGOTIATED RESPONSE ENCODING ---
+
+// writeNegotiated encodes v according to the request's Accept header,
+// defaulting to JSON when the client didn't ask for something else.
+func writeNegotiated(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	accept := r.Header.Get("Accept")
+	if strings.Contains(accept, "application/xml") || strings.Contains(accept, "text/xml") {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(status)
+		xml.NewEncoder(w).Encode(v)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// sendBindError writes a 400 with either a plain message (decode failure)
+// or a structured field-error list (validation failure), negotiated to
+// the request's Accept header.
+func sendBindError(w http.ResponseWriter, r *http.Request, err error) {
+	if fields := fieldErrorsFrom(err); fields != nil {
+		writeNegotiated(w, r, http.StatusBadRequest, ValidationErrorResponse{
+			Error:  "validation failed",
+			Fields: fields,
+		})
+		return
+	}
+	writeNegotiated(w, r, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+}
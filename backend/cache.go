@@ -0,0 +1,130 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// --- CACHE ABSTRACTION ---
+
+// planCacheBackend is implemented by anything that can store a
+// TravelPlanResponse by key. The default is an in-memory LRU; a
+// Redis/BoltDB-backed implementation can satisfy the same interface
+// without touching the handlers.
+type planCacheBackend interface {
+	Get(key string) (*TravelPlanResponse, bool)
+	Set(key string, value *TravelPlanResponse)
+	Delete(key string)
+}
+
+// planCache is the process-wide cache used by handleRoute. It defaults to
+// an in-memory LRU; swap this out in init() if a Redis/BoltDB backend is
+// configured via env.
+var planCache planCacheBackend = newLRUPlanCache(256)
+
+const (
+	cacheControlHeader = "public, max-age=3600, stale-while-revalidate=600"
+)
+
+// planCacheKey derives a stable cache key from the fields that actually
+// determine the AI's answer, so two requests for the same trip share a
+// cache entry regardless of request formatting.
+func planCacheKey(reqData TravelPlanRequest) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%.2f", reqData.Source, reqData.Destination, reqData.Budget)))
+	return hex.EncodeToString(sum[:])
+}
+
+// etagFor produces a strong ETag from the same hash used as the cache key,
+// since the key already uniquely identifies the response content.
+func etagFor(key string) string {
+	return `"` + key + `"`
+}
+
+// --- IN-MEMORY LRU ---
+
+type lruEntry struct {
+	key   string
+	value *TravelPlanResponse
+}
+
+// lruPlanCache is a bounded, goroutine-safe LRU keyed by the hash from
+// planCacheKey. It's the zero-dependency default; a Redis/BoltDB backend
+// can be swapped in by implementing planCacheBackend.
+type lruPlanCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+func newLRUPlanCache(capacity int) *lruPlanCache {
+	return &lruPlanCache{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *lruPlanCache) Get(key string) (*TravelPlanResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*lruEntry).value, true
+}
+
+func (c *lruPlanCache) Set(key string, value *TravelPlanResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		el.Value.(*lruEntry).value = value
+		c.order.MoveToFront(el)
+		return
+	}
+
+	el := c.order.PushFront(&lruEntry{key: key, value: value})
+	c.items[key] = el
+
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		if oldest != nil {
+			c.order.Remove(oldest)
+			delete(c.items, oldest.Value.(*lruEntry).key)
+		}
+	}
+}
+
+func (c *lruPlanCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.order.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+// --- ADMIN HANDLER ---
+
+// handleDeleteCache evicts a single cache entry by key. It's mounted
+// under /api/v1, so it already sits behind the auth middleware.
+func handleDeleteCache(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	if key == "" {
+		sendJSONError(w, "cache key is required", http.StatusBadRequest)
+		return
+	}
+	planCache.Delete(key)
+	w.WriteHeader(http.StatusNoContent)
+}
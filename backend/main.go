@@ -2,16 +2,24 @@ package main
 
 import (
 	"bufio"
-	"bytes"
+	"context"
 	"encoding/json"
+	"encoding/xml"
+	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"net/http/pprof"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/cors"
 	"github.com/joho/godotenv"
 )
 
@@ -19,6 +27,12 @@ import (
 
 var openRouterAPIKey string
 var httpClient *http.Client
+var apiAuthSecret string
+var apiRateLimiter *rateLimiter
+
+// streamWG tracks in-flight SSE handlers so graceful shutdown can wait for
+// them to finish instead of cutting an in-progress plan stream off.
+var streamWG sync.WaitGroup
 
 func init() {
 	if err := godotenv.Load(); err != nil {
@@ -39,31 +53,43 @@ func init() {
 			IdleConnTimeout:     90 * time.Second,
 		},
 	}
+
+	apiAuthSecret = os.Getenv("API_AUTH_SECRET")
+	if apiAuthSecret == "" {
+		log.Println("⚠️  API_AUTH_SECRET is not set, /api/v1 routes are unauthenticated")
+	}
+
+	// 10 requests/sec sustained, bursts up to 20 — generous enough for a
+	// real client polling a stream, tight enough to protect the OpenRouter
+	// key from being burned by anonymous traffic.
+	apiRateLimiter = newRateLimiter(10, 20)
 }
 
 // --- DATA STRUCTURES ---
 
 type TravelPlanRequest struct {
-	Source      string  `json:"source"`
-	Destination string  `json:"destination"`
-	Budget      float64 `json:"budget"`
+	XMLName     xml.Name `json:"-" xml:"TravelPlanRequest" form:"-"`
+	Source      string   `json:"source" xml:"source" form:"source" validate:"required"`
+	Destination string   `json:"destination" xml:"destination" form:"destination" validate:"required"`
+	Budget      float64  `json:"budget" xml:"budget" form:"budget" validate:"required,gt=0"`
 }
 
 type DayPlan struct {
-	Day        int                `json:"day"`
-	Activities string             `json:"activities"`
-	Expenses   map[string]float64 `json:"expenses"`
+	Day        int                `json:"day" xml:"day"`
+	Activities string             `json:"activities" xml:"activities"`
+	Expenses   map[string]float64 `json:"expenses" xml:"-"` // encoding/xml can't marshal maps; XML clients only get day/activities
 }
 
 type TravelPlanResponse struct {
-	Source      string    `json:"source"`
-	Destination string    `json:"destination"`
-	Budget      float64   `json:"budget"`
-	Days        []DayPlan `json:"days"`
+	XMLName     xml.Name  `json:"-" xml:"TravelPlanResponse"`
+	Source      string    `json:"source" xml:"source"`
+	Destination string    `json:"destination" xml:"destination"`
+	Budget      float64   `json:"budget" xml:"budget"`
+	Days        []DayPlan `json:"days" xml:"days>day"`
 }
 
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error string `json:"error" xml:"error"`
 }
 
 // Struct for streaming requests
@@ -86,21 +112,103 @@ type OpenRouterResponse struct {
 			Content string `json:"content"`
 		} `json:"message"`
 	} `json:"choices"`
+	Usage *openRouterUsage `json:"usage"`
+}
+
+// openRouterUsage mirrors the `usage` object OpenAI-compatible providers
+// return alongside the completion, used to feed the LLM token metrics.
+type openRouterUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
 }
 
 // --- MAIN FUNCTION ---
 
 func main() {
-	// Keep the original non-streaming route for comparison or fallback
-	http.HandleFunc("/api/route", handleRoute)
-	// Add the new, faster streaming route
-	http.HandleFunc("/api/route-stream", handleRouteStream)
-	http.HandleFunc("/health", handleHealth)
-
-	fmt.Println("✅ Server is running on http://localhost:8080")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		log.Fatalf("❌ Could not start server: %v", err)
+	debug := flag.Bool("debug", false, "expose /debug/pprof behind the auth middleware")
+	flag.Parse()
+
+	shutdownTracing := initTracing(context.Background())
+
+	r := chi.NewRouter()
+	r.Use(chimiddleware.RequestID)
+	r.Use(chimiddleware.Logger)
+	r.Use(chimiddleware.Recoverer)
+	r.Use(metricsMiddleware)
+	r.Use(cors.Handler(cors.Options{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key"},
+		MaxAge:         300,
+	}))
+
+	r.Get("/health", handleHealth)
+	r.Handle("/metrics", metricsHandler())
+
+	r.Route("/api/v1", func(api chi.Router) {
+		api.Use(apiRateLimiter.middleware)
+		api.Use(authMiddleware(apiAuthSecret))
+
+		api.Post("/route", handleRoute)
+		api.Post("/route-stream", handleRouteStream)
+		// Mounted at /api/v1/cache/{key} rather than the bare /api/cache/:key
+		// so it picks up apiRateLimiter and authMiddleware from this group
+		// instead of duplicating "guarded by auth" route-by-route.
+		api.Delete("/cache/{key}", handleDeleteCache)
+
+		if *debug {
+			api.Mount("/debug/pprof", pprofRouter())
+		}
+	})
+
+	srv := &http.Server{
+		Addr:    ":8080",
+		Handler: r,
+	}
+
+	go func() {
+		fmt.Println("✅ Server is running on http://localhost:8080")
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("❌ Could not start server: %v", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	stop()
+
+	log.Println("🛑 Shutdown signal received, draining in-flight requests...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("🚨 Server shutdown error: %v", err)
 	}
+
+	streamWG.Wait()
+
+	tracingShutdownCtx, cancelTracing := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelTracing()
+	if err := shutdownTracing(tracingShutdownCtx); err != nil {
+		log.Printf("🚨 Tracing shutdown error: %v", err)
+	}
+
+	log.Println("✅ Shutdown complete")
+}
+
+// pprofRouter wires up the stdlib pprof handlers under a sub-router so
+// they can be mounted behind the auth middleware instead of their usual
+// home on DefaultServeMux.
+func pprofRouter() http.Handler {
+	mux := chi.NewRouter()
+	mux.HandleFunc("/", pprof.Index)
+	mux.HandleFunc("/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/profile", pprof.Profile)
+	mux.HandleFunc("/symbol", pprof.Symbol)
+	mux.HandleFunc("/trace", pprof.Trace)
+	return mux
 }
 
 // --- HTTP HANDLERS ---
@@ -114,27 +222,33 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 
 // Non-streaming handler
 func handleRoute(w http.ResponseWriter, r *http.Request) {
-	enableCORS(w)
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	var reqData TravelPlanRequest
-	if err := json.NewDecoder(r.Body).Decode(&reqData); err != nil {
-		sendJSONError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+	if err := Bind(r, &reqData); err != nil {
+		sendBindError(w, r, err)
 		return
 	}
 
-	if reqData.Source == "" || reqData.Destination == "" || reqData.Budget <= 0 {
-		sendJSONError(w, "Source, destination, and a positive budget are required", http.StatusBadRequest)
+	cacheKey := planCacheKey(reqData)
+	etag := etagFor(cacheKey)
+
+	if cached, ok := planCache.Get(cacheKey); ok {
+		recordCacheResult(true)
+		if r.Header.Get("If-None-Match") == etag {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writeTravelPlan(w, r, cached, etag)
 		return
 	}
+	recordCacheResult(false)
 
 	prompt := createPrompt(reqData)
-	responseText, err := callOpenRouter(prompt, "You are a professional travel planner AI. You ONLY respond with valid JSON.")
+	messages := plannerMessages(prompt)
+	chain := selectProviderChain(r)
+	responseText, err := completeWithFallback(r.Context(), chain, messages)
 	if err != nil {
-		log.Printf("🚨 OpenRouter API error: %v", err)
+		log.Printf("🚨 LLM provider error: %v", err)
 		sendJSONError(w, "Failed to get response from AI: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -149,33 +263,34 @@ func handleRoute(w http.ResponseWriter, r *http.Request) {
 	// Parse and validate JSON response
 	var travelPlan TravelPlanResponse
 	if err := json.Unmarshal([]byte(responseText), &travelPlan); err != nil {
+		recordJSONParseFailure("complete")
 		log.Printf("🚨 Failed to parse AI response as JSON: %v\nResponse: %s", err, responseText)
 		sendJSONError(w, "AI returned invalid JSON format", http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(travelPlan)
+	planCache.Set(cacheKey, &travelPlan)
+	writeTravelPlan(w, r, &travelPlan, etag)
+}
+
+// writeTravelPlan writes a 200 response with caching headers so repeat
+// callers with a fresh copy can rely on a 304 on their next request,
+// encoding the body to match the request's Accept header.
+func writeTravelPlan(w http.ResponseWriter, r *http.Request, plan *TravelPlanResponse, etag string) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControlHeader)
+	writeNegotiated(w, r, http.StatusOK, plan)
 }
 
 // Streaming Handler
 func handleRouteStream(w http.ResponseWriter, r *http.Request) {
-	enableCORS(w)
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
+	streamWG.Add(1)
+	defer streamWG.Done()
 
 	// 1. Decode and Validate Request Body
 	var reqData TravelPlanRequest
-	if err := json.NewDecoder(r.Body).Decode(&reqData); err != nil {
-		sendJSONError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	if reqData.Source == "" || reqData.Destination == "" || reqData.Budget <= 0 {
-		sendJSONError(w, "Source, destination, and a positive budget are required", http.StatusBadRequest)
+	if err := Bind(r, &reqData); err != nil {
+		sendBindError(w, r, err)
 		return
 	}
 
@@ -183,8 +298,7 @@ func handleRouteStream(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	enableCORS(w) // Ensure CORS headers are set for streaming too
-	
+
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		sendJSONError(w, "Streaming not supported!", http.StatusInternalServerError)
@@ -193,32 +307,64 @@ func handleRouteStream(w http.ResponseWriter, r *http.Request) {
 
 	// 3. Create the AI Prompt
 	prompt := createPrompt(reqData)
+	messages := plannerMessages(prompt)
 
-	// 4. Call the Streaming AI Function
-	stream, err := callOpenRouterStream(prompt, "You are a professional travel planner AI. You ONLY respond with valid JSON.")
+	// 4. Call the Streaming AI Function, trying providers in order
+	chain := selectProviderChain(r)
+	stream, providerName, err := streamWithFallback(r.Context(), chain, messages)
 	if err != nil {
-		log.Printf("🚨 OpenRouter Stream API error: %v", err)
+		log.Printf("🚨 LLM provider stream error: %v", err)
 		// Send error as SSE event
 		fmt.Fprintf(w, "data: {\"error\": \"%s\"}\n\n", err.Error())
 		flusher.Flush()
 		return
 	}
+	log.Printf("streaming via provider %q", providerName)
 	defer stream.Close()
 
-	// 5. Proxy the stream to the client
+	// 5. Accumulate the upstream chunks and emit a `day` SSE event the
+	// moment each DayPlan object closes, instead of forwarding raw
+	// fragments for the client to reassemble itself.
+	var acc planStreamAccumulator
 	scanner := bufio.NewScanner(stream)
 	for scanner.Scan() {
 		line := scanner.Text()
-		if strings.HasPrefix(line, "data:") {
-			// Forward the data chunk directly to the client
-			fmt.Fprintf(w, "%s\n\n", line)
-			flusher.Flush()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if payload == "[DONE]" {
+			break
+		}
+		recordStreamChunk(providerName)
+
+		for _, day := range acc.feed(extractDeltaContent(payload)) {
+			writeSSEEvent(w, flusher, "day", day)
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		log.Printf("🚨 Error reading stream from OpenRouter: %v", err)
+		log.Printf("🚨 Error reading stream from LLM provider: %v", err)
+	}
+
+	plan, err := acc.finalize()
+	if err != nil {
+		recordJSONParseFailure("stream")
+		log.Printf("🚨 Failed to parse assembled AI response: %v\nResponse: %s", err, acc.raw.String())
+		writeSSEEvent(w, flusher, "error", ErrorResponse{Error: "AI returned invalid JSON format"})
+		return
+	}
+
+	if total, exceeded := budgetExceeds(plan); exceeded {
+		writeSSEEvent(w, flusher, "warning", WarningResponse{
+			Warning: fmt.Sprintf("planned expenses (%.2f) exceed budget (%.2f)", total, plan.Budget),
+			Plan:    plan,
+		})
+		return
 	}
+
+	planCache.Set(planCacheKey(reqData), &plan)
+	writeSSEEvent(w, flusher, "done", plan)
 }
 
 // --- HELPER FUNCTIONS ---
@@ -236,101 +382,13 @@ func createPrompt(reqData TravelPlanRequest) string {
 	)
 }
 
-// Non-streaming OpenRouter call
-func callOpenRouter(prompt, systemMessage string) (string, error) {
-	apiURL := "https://openrouter.ai/api/v1/chat/completions"
-
-	payload := map[string]interface{}{
-		"model": "anthropic/claude-3-haiku",
-		"messages": []OpenRouterMessage{
-			{Role: "system", Content: systemMessage},
-			{Role: "user", Content: prompt},
-		},
-	}
-
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request payload: %w", err)
-	}
-
-	req, err := http.NewRequest(http.MethodPost, apiURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create http request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+openRouterAPIKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("HTTP-Referer", "http://localhost:8080")
-	req.Header.Set("X-Title", "Go Travel Planner")
-
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to send request to OpenRouter: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("received non-200 status code (%d): %s", resp.StatusCode, string(body))
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	var openRouterResp OpenRouterResponse
-	if err := json.Unmarshal(body, &openRouterResp); err != nil {
-		return "", fmt.Errorf("failed to unmarshal OpenRouter response: %w", err)
-	}
-
-	if len(openRouterResp.Choices) == 0 {
-		return "", fmt.Errorf("no choices returned from OpenRouter")
-	}
-
-	return openRouterResp.Choices[0].Message.Content, nil
-}
-
-// Streaming OpenRouter call
-func callOpenRouterStream(prompt, systemMessage string) (io.ReadCloser, error) {
-	apiURL := "https://openrouter.ai/api/v1/chat/completions"
-
-	payload := OpenRouterStreamRequest{
-		Model: "anthropic/claude-3-haiku",
-		Messages: []OpenRouterMessage{
-			{Role: "system", Content: systemMessage},
-			{Role: "user", Content: prompt},
-		},
-		Stream: true,
-	}
-
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request payload: %w", err)
-	}
-
-	req, err := http.NewRequest(http.MethodPost, apiURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create http request: %w", err)
+// plannerMessages wraps a prompt with the travel-planner system message in
+// the shape every LLMProvider expects.
+func plannerMessages(prompt string) []OpenRouterMessage {
+	return []OpenRouterMessage{
+		{Role: "system", Content: "You are a professional travel planner AI. You ONLY respond with valid JSON."},
+		{Role: "user", Content: prompt},
 	}
-
-	req.Header.Set("Authorization", "Bearer "+openRouterAPIKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("HTTP-Referer", "http://localhost:8080")
-	req.Header.Set("X-Title", "Go Travel Planner")
-
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request to OpenRouter: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		return nil, fmt.Errorf("received non-200 status code (%d): %s", resp.StatusCode, string(body))
-	}
-
-	return resp.Body, nil
 }
 
 // Send JSON error response
@@ -339,10 +397,3 @@ func sendJSONError(w http.ResponseWriter, message string, statusCode int) {
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
 }
-
-// Enable CORS for cross-origin requests
-func enableCORS(w http.ResponseWriter) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-}
\ No newline at end of file
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// --- PROMETHEUS METRICS ---
+//
+// Cost and latency here are dominated by the upstream LLM call, so the
+// metrics below are built around that: how often we hit it, how long it
+// takes per provider/model, how many tokens it burns, and how often the
+// cache or the streaming JSON parser saves/costs us a round trip.
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "travelplanner_http_requests_total",
+		Help: "Total HTTP requests, labeled by route and status code.",
+	}, []string{"route", "status"})
+
+	llmCallDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "travelplanner_llm_call_duration_seconds",
+		Help:    "Latency of LLM provider calls, labeled by provider and model.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"provider", "model"})
+
+	llmTokensTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "travelplanner_llm_tokens_total",
+		Help: "Tokens consumed by LLM calls, labeled by provider, model, and token kind (prompt/completion).",
+	}, []string{"provider", "model", "kind"})
+
+	streamChunksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "travelplanner_stream_chunks_total",
+		Help: "SSE chunks received from an upstream provider stream, labeled by provider.",
+	}, []string{"provider"})
+
+	cacheResultsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "travelplanner_cache_results_total",
+		Help: "Plan cache lookups, labeled by result (hit/miss).",
+	}, []string{"result"})
+
+	jsonParseFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "travelplanner_json_parse_failures_total",
+		Help: "Failures parsing an LLM response as JSON, labeled by stage (complete/stream).",
+	}, []string{"stage"})
+)
+
+// metricsMiddleware records a request count by route pattern and status
+// code. It's mounted above the chi router so it sees every route,
+// including ones that 404. It wraps the response in chi's own
+// WrapResponseWriter rather than a bare embedding, since that one already
+// forwards Flusher/Hijacker to the handler below — handleRouteStream's
+// `w.(http.Flusher)` assertion depends on that.
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		httpRequestsTotal.WithLabelValues(routePattern(r), strconv.Itoa(ww.Status())).Inc()
+	})
+}
+
+// routePattern prefers the chi-matched pattern (e.g. "/api/v1/cache/{key}")
+// over the raw path, falling back to a fixed "unmatched" label instead of
+// the raw path so an unauthenticated scanner probing random paths can't
+// blow up httpRequestsTotal's cardinality.
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+	return "unmatched"
+}
+
+// metricsHandler exposes the registered collectors in the Prometheus
+// text exposition format for /metrics to be scraped.
+func metricsHandler() http.Handler {
+	return promhttp.Handler()
+}
+
+// recordLLMCall observes call latency and token usage for one LLM
+// request/response pair.
+func recordLLMCall(provider, model string, start time.Time, usage *openRouterUsage) {
+	llmCallDuration.WithLabelValues(provider, model).Observe(time.Since(start).Seconds())
+	if usage == nil {
+		return
+	}
+	llmTokensTotal.WithLabelValues(provider, model, "prompt").Add(float64(usage.PromptTokens))
+	llmTokensTotal.WithLabelValues(provider, model, "completion").Add(float64(usage.CompletionTokens))
+}
+
+func recordCacheResult(hit bool) {
+	if hit {
+		cacheResultsTotal.WithLabelValues("hit").Inc()
+		return
+	}
+	cacheResultsTotal.WithLabelValues("miss").Inc()
+}
+
+func recordJSONParseFailure(stage string) {
+	jsonParseFailuresTotal.WithLabelValues(stage).Inc()
+}
+
+func recordStreamChunk(provider string) {
+	streamChunksTotal.WithLabelValues(provider).Inc()
+}
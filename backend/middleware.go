@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// --- AUTH MIDDLEWARE ---
+
+// authMiddleware validates requests against a configured bearer secret
+// using a constant-time comparison so response timing can't leak how much
+// of the token was guessed correctly. A request is let through untouched
+// when no secret is configured, since local/dev setups shouldn't need one.
+func authMiddleware(secret string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if secret == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token := bearerToken(r)
+			if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+				sendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) <= len(prefix) || auth[:len(prefix)] != prefix {
+		return ""
+	}
+	return auth[len(prefix):]
+}
+
+// --- RATE LIMITING ---
+
+// tokenBucket is a classic token-bucket limiter: it holds up to `burst`
+// tokens, refilling at `ratePerSecond`, and denies a request when empty.
+type tokenBucket struct {
+	mu         sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+	lastSeen   time.Time
+	rate       float64
+	burst      float64
+}
+
+func newTokenBucket(ratePerSecond float64, burst float64) *tokenBucket {
+	now := time.Now()
+	return &tokenBucket{tokens: burst, lastRefill: now, lastSeen: now, rate: ratePerSecond, burst: burst}
+}
+
+func (b *tokenBucket) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(b.lastRefill).Seconds()
+	b.lastRefill = now
+	b.lastSeen = now
+
+	b.tokens += elapsed * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *tokenBucket) idleSince(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return now.Sub(b.lastSeen)
+}
+
+// bucketTTL bounds how long an idle IP+API-key bucket is kept around —
+// without this, buckets is an unbounded map for the life of the process,
+// and an anonymous caller rotating source IPs can grow it without limit.
+const bucketTTL = 10 * time.Minute
+
+// rateLimiter keys buckets by client IP + API key so a single misbehaving
+// caller can't starve everyone sharing a NAT'd IP, and an anonymous caller
+// can't burn through the budget of a caller who bothered to authenticate.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	rate    float64
+	burst   float64
+}
+
+func newRateLimiter(ratePerSecond float64, burst float64) *rateLimiter {
+	l := &rateLimiter{
+		buckets: make(map[string]*tokenBucket),
+		rate:    ratePerSecond,
+		burst:   burst,
+	}
+	go l.sweepLoop()
+	return l
+}
+
+// sweepLoop periodically evicts buckets that haven't been touched within
+// bucketTTL, running for the lifetime of the process since rateLimiter is
+// a process-wide singleton.
+func (l *rateLimiter) sweepLoop() {
+	ticker := time.NewTicker(bucketTTL / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		l.sweep()
+	}
+}
+
+func (l *rateLimiter) sweep() {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, b := range l.buckets {
+		if b.idleSince(now) > bucketTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *rateLimiter) bucketFor(key string) *tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = newTokenBucket(l.rate, l.burst)
+		l.buckets[key] = b
+	}
+	return b
+}
+
+func rateLimitKey(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	apiKey := r.Header.Get("X-API-Key")
+	return ip + "|" + apiKey
+}
+
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bucket := l.bucketFor(rateLimitKey(r))
+		if !bucket.allow() {
+			sendJSONError(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
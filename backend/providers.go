@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// --- LLM PROVIDER ABSTRACTION ---
+
+// LLMProvider is implemented by every backend capable of answering a chat
+// completion request, whether that's OpenRouter, a vendor API directly, or
+// a proxy that translates to one of those shapes.
+type LLMProvider interface {
+	Name() string
+	Complete(ctx context.Context, messages []OpenRouterMessage) (string, error)
+	Stream(ctx context.Context, messages []OpenRouterMessage) (io.ReadCloser, error)
+}
+
+// providerRegistry holds every configured provider, keyed by the name used
+// in the `?provider=` query param / `X-LLM-Provider` header.
+var providerRegistry = map[string]LLMProvider{}
+
+// providerFallbackChain is the ordered list of provider names to try when
+// the caller doesn't pin a specific one, or when the pinned one fails.
+var providerFallbackChain []string
+
+func init() {
+	registerProvider(newOpenRouterProvider())
+
+	if key := os.Getenv("OPENAI_API_KEY"); key != "" {
+		registerProvider(newOpenAIProvider(key))
+	}
+	if key := os.Getenv("ANTHROPIC_API_KEY"); key != "" {
+		registerProvider(newAnthropicProvider(key))
+	}
+	if token := os.Getenv("COPILOT_API_TOKEN"); token != "" {
+		registerProvider(newCopilotProvider(token))
+	}
+
+	providerFallbackChain = parseFallbackChain(os.Getenv("LLM_PROVIDER_FALLBACK"))
+}
+
+func registerProvider(p LLMProvider) {
+	providerRegistry[p.Name()] = p
+}
+
+// parseFallbackChain reads a comma-separated config value like
+// "openrouter,openai,anthropic" and falls back to every registered provider
+// (in registration order) when unset.
+func parseFallbackChain(raw string) []string {
+	if raw == "" {
+		return []string{"openrouter", "openai", "anthropic", "copilot"}
+	}
+	parts := strings.Split(raw, ",")
+	chain := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			chain = append(chain, p)
+		}
+	}
+	return chain
+}
+
+// selectProviderChain resolves the ordered list of providers to try for a
+// given request: the explicitly requested provider first (if any and if
+// registered), then the configured fallback chain, skipping duplicates and
+// anything that isn't registered.
+func selectProviderChain(r *http.Request) []LLMProvider {
+	requested := r.URL.Query().Get("provider")
+	if requested == "" {
+		requested = r.Header.Get("X-LLM-Provider")
+	}
+
+	seen := map[string]bool{}
+	var chain []LLMProvider
+
+	addIfAvailable := func(name string) {
+		if name == "" || seen[name] {
+			return
+		}
+		if p, ok := providerRegistry[name]; ok {
+			chain = append(chain, p)
+			seen[name] = true
+		}
+	}
+
+	addIfAvailable(requested)
+	for _, name := range providerFallbackChain {
+		addIfAvailable(name)
+	}
+	return chain
+}
+
+// completeWithFallback tries each provider in order, moving to the next
+// one on error so a regional OpenRouter outage (or any single provider
+// hiccup) doesn't take the whole service down.
+func completeWithFallback(ctx context.Context, chain []LLMProvider, messages []OpenRouterMessage) (string, error) {
+	if len(chain) == 0 {
+		return "", fmt.Errorf("no LLM provider available")
+	}
+
+	var lastErr error
+	for _, p := range chain {
+		text, err := p.Complete(ctx, messages)
+		if err == nil {
+			return text, nil
+		}
+		if ctx.Err() != nil {
+			// The caller went away (or its deadline passed) mid-call —
+			// stop here instead of burning the remaining providers in
+			// the chain on a request nobody is waiting for anymore.
+			return "", ctx.Err()
+		}
+		logProviderFallback(p.Name(), err)
+		lastErr = err
+	}
+	return "", fmt.Errorf("all providers failed, last error: %w", lastErr)
+}
+
+// streamWithFallback mirrors completeWithFallback for the streaming path.
+func streamWithFallback(ctx context.Context, chain []LLMProvider, messages []OpenRouterMessage) (io.ReadCloser, string, error) {
+	if len(chain) == 0 {
+		return nil, "", fmt.Errorf("no LLM provider available")
+	}
+
+	var lastErr error
+	for _, p := range chain {
+		stream, err := p.Stream(ctx, messages)
+		if err == nil {
+			return stream, p.Name(), nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		logProviderFallback(p.Name(), err)
+		lastErr = err
+	}
+	return nil, "", fmt.Errorf("all providers failed, last error: %w", lastErr)
+}
+
+func logProviderFallback(provider string, err error) {
+	log.Printf("⚠️  LLM provider %q failed, trying next in chain: %v", provider, err)
+}
+
+// --- SHARED HELPERS ---
+
+// doChatCompletion is the common non-streaming request/response shape used
+// by every OpenAI-compatible provider (OpenRouter, OpenAI itself, and the
+// Copilot proxy all speak this dialect). It wraps the call in an LLM span
+// and records latency/token metrics under providerName/model so every
+// adapter gets observability for free.
+func doChatCompletion(ctx context.Context, providerName, apiURL, model string, messages []OpenRouterMessage, applyHeaders func(*http.Request)) (string, error) {
+	ctx, span := startLLMSpan(ctx, providerName, model)
+	defer span.End()
+	start := time.Now()
+
+	payload := map[string]interface{}{
+		"model":    model,
+		"messages": messages,
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("failed to create http request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	applyHeaders(req)
+	injectTraceparent(ctx, req)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		recordLLMCall(providerName, model, start, nil)
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		recordLLMCall(providerName, model, start, nil)
+		return "", fmt.Errorf("received non-200 status code (%d): %s", resp.StatusCode, string(body))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		recordLLMCall(providerName, model, start, nil)
+		return "", fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var chatResp OpenRouterResponse
+	if err := json.Unmarshal(body, &chatResp); err != nil {
+		recordLLMCall(providerName, model, start, nil)
+		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if len(chatResp.Choices) == 0 {
+		recordLLMCall(providerName, model, start, nil)
+		return "", fmt.Errorf("no choices returned")
+	}
+
+	recordLLMCall(providerName, model, start, chatResp.Usage)
+	recordSpanUsage(span, chatResp.Usage)
+	return chatResp.Choices[0].Message.Content, nil
+}
+
+// doChatCompletionStream is the streaming counterpart of doChatCompletion.
+// Token counts aren't known until the stream is fully consumed, so this
+// only records call latency; per-chunk counts are tracked by the caller
+// via recordStreamChunk as chunks arrive.
+func doChatCompletionStream(ctx context.Context, providerName, apiURL, model string, messages []OpenRouterMessage, applyHeaders func(*http.Request)) (io.ReadCloser, error) {
+	ctx, span := startLLMSpan(ctx, providerName, model)
+	start := time.Now()
+
+	payload := OpenRouterStreamRequest{
+		Model:    model,
+		Messages: messages,
+		Stream:   true,
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		span.End()
+		return nil, fmt.Errorf("failed to marshal request payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		span.End()
+		return nil, fmt.Errorf("failed to create http request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	applyHeaders(req)
+	injectTraceparent(ctx, req)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		recordLLMCall(providerName, model, start, nil)
+		span.End()
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		recordLLMCall(providerName, model, start, nil)
+		span.End()
+		return nil, fmt.Errorf("received non-200 status code (%d): %s", resp.StatusCode, string(body))
+	}
+
+	recordLLMCall(providerName, model, start, nil)
+	// The span covers connection setup only; it ends here rather than
+	// wrapping the full read loop since the caller owns the stream's
+	// lifetime from this point on.
+	span.End()
+	return resp.Body, nil
+}
+
+// --- OPENROUTER ---
+
+type openRouterProvider struct {
+	apiKey string
+	model  string
+}
+
+func newOpenRouterProvider() *openRouterProvider {
+	return &openRouterProvider{apiKey: openRouterAPIKey, model: "anthropic/claude-3-haiku"}
+}
+
+func (p *openRouterProvider) Name() string { return "openrouter" }
+
+func (p *openRouterProvider) headers(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	req.Header.Set("HTTP-Referer", "http://localhost:8080")
+	req.Header.Set("X-Title", "Go Travel Planner")
+}
+
+func (p *openRouterProvider) Complete(ctx context.Context, messages []OpenRouterMessage) (string, error) {
+	return doChatCompletion(ctx, p.Name(), "https://openrouter.ai/api/v1/chat/completions", p.model, messages, p.headers)
+}
+
+func (p *openRouterProvider) Stream(ctx context.Context, messages []OpenRouterMessage) (io.ReadCloser, error) {
+	return doChatCompletionStream(ctx, p.Name(), "https://openrouter.ai/api/v1/chat/completions", p.model, messages, p.headers)
+}
+
+// --- OPENAI ---
+
+type openAIProvider struct {
+	apiKey string
+	model  string
+}
+
+func newOpenAIProvider(apiKey string) *openAIProvider {
+	return &openAIProvider{apiKey: apiKey, model: "gpt-4o-mini"}
+}
+
+func (p *openAIProvider) Name() string { return "openai" }
+
+func (p *openAIProvider) headers(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+}
+
+func (p *openAIProvider) Complete(ctx context.Context, messages []OpenRouterMessage) (string, error) {
+	return doChatCompletion(ctx, p.Name(), "https://api.openai.com/v1/chat/completions", p.model, messages, p.headers)
+}
+
+func (p *openAIProvider) Stream(ctx context.Context, messages []OpenRouterMessage) (io.ReadCloser, error) {
+	return doChatCompletionStream(ctx, p.Name(), "https://api.openai.com/v1/chat/completions", p.model, messages, p.headers)
+}
+
+// --- ANTHROPIC (DIRECT) ---
+
+// anthropicProvider talks to the Messages API directly, which doesn't
+// share OpenAI's request/response shape, so it translates on both ends
+// instead of reusing doChatCompletion.
+type anthropicProvider struct {
+	apiKey string
+	model  string
+}
+
+func newAnthropicProvider(apiKey string) *anthropicProvider {
+	return &anthropicProvider{apiKey: apiKey, model: "claude-3-haiku-20240307"}
+}
+
+func (p *anthropicProvider) Name() string { return "anthropic" }
+
+type anthropicMessagesRequest struct {
+	Model     string              `json:"model"`
+	System    string              `json:"system,omitempty"`
+	Messages  []OpenRouterMessage `json:"messages"`
+	MaxTokens int                 `json:"max_tokens"`
+	Stream    bool                `json:"stream"`
+}
+
+type anthropicMessagesResponse struct {
+	Content []struct {
+		Text string `json:"text"`
+	} `json:"content"`
+	Usage struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+func splitSystemMessage(messages []OpenRouterMessage) (string, []OpenRouterMessage) {
+	var system string
+	rest := make([]OpenRouterMessage, 0, len(messages))
+	for _, m := range messages {
+		if m.Role == "system" && system == "" {
+			system = m.Content
+			continue
+		}
+		rest = append(rest, m)
+	}
+	return system, rest
+}
+
+func (p *anthropicProvider) Complete(ctx context.Context, messages []OpenRouterMessage) (string, error) {
+	ctx, span := startLLMSpan(ctx, p.Name(), p.model)
+	defer span.End()
+	start := time.Now()
+
+	system, rest := splitSystemMessage(messages)
+	payload := anthropicMessagesRequest{Model: p.model, System: system, Messages: rest, MaxTokens: 4096}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("failed to create http request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", p.apiKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+	injectTraceparent(ctx, req)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		recordLLMCall(p.Name(), p.model, start, nil)
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		recordLLMCall(p.Name(), p.model, start, nil)
+		return "", fmt.Errorf("received non-200 status code (%d): %s", resp.StatusCode, string(body))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		recordLLMCall(p.Name(), p.model, start, nil)
+		return "", fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var msgResp anthropicMessagesResponse
+	if err := json.Unmarshal(body, &msgResp); err != nil {
+		recordLLMCall(p.Name(), p.model, start, nil)
+		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if len(msgResp.Content) == 0 {
+		recordLLMCall(p.Name(), p.model, start, nil)
+		return "", fmt.Errorf("no content returned")
+	}
+
+	usage := &openRouterUsage{PromptTokens: msgResp.Usage.InputTokens, CompletionTokens: msgResp.Usage.OutputTokens}
+	recordLLMCall(p.Name(), p.model, start, usage)
+	recordSpanUsage(span, usage)
+	return msgResp.Content[0].Text, nil
+}
+
+func (p *anthropicProvider) Stream(ctx context.Context, messages []OpenRouterMessage) (io.ReadCloser, error) {
+	ctx, span := startLLMSpan(ctx, p.Name(), p.model)
+	start := time.Now()
+
+	system, rest := splitSystemMessage(messages)
+	payload := anthropicMessagesRequest{Model: p.model, System: system, Messages: rest, MaxTokens: 4096, Stream: true}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		span.End()
+		return nil, fmt.Errorf("failed to marshal request payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
+	if err != nil {
+		span.End()
+		return nil, fmt.Errorf("failed to create http request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", p.apiKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+	injectTraceparent(ctx, req)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		recordLLMCall(p.Name(), p.model, start, nil)
+		span.End()
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		recordLLMCall(p.Name(), p.model, start, nil)
+		span.End()
+		return nil, fmt.Errorf("received non-200 status code (%d): %s", resp.StatusCode, string(body))
+	}
+
+	recordLLMCall(p.Name(), p.model, start, nil)
+	span.End()
+	return resp.Body, nil
+}
+
+// --- COPILOT-GPT4 STYLE PROXY ---
+
+// copilotProvider talks to a copilot-gpt4-service-style proxy that
+// translates the Copilot Chat API into OpenAI-compatible calls. Those
+// proxies require the Editor-Version/Copilot-Integration-Id headers
+// Copilot's own backends use to distinguish client integrations.
+type copilotProvider struct {
+	token    string
+	endpoint string
+	model    string
+}
+
+func newCopilotProvider(token string) *copilotProvider {
+	endpoint := os.Getenv("COPILOT_PROXY_URL")
+	if endpoint == "" {
+		endpoint = "http://localhost:8081/v1/chat/completions"
+	}
+	return &copilotProvider{token: token, endpoint: endpoint, model: "gpt-4"}
+}
+
+func (p *copilotProvider) Name() string { return "copilot" }
+
+func (p *copilotProvider) headers(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Editor-Version", "vscode/1.90.0")
+	req.Header.Set("Copilot-Integration-Id", "vscode-chat")
+}
+
+func (p *copilotProvider) Complete(ctx context.Context, messages []OpenRouterMessage) (string, error) {
+	return doChatCompletion(ctx, p.Name(), p.endpoint, p.model, messages, p.headers)
+}
+
+func (p *copilotProvider) Stream(ctx context.Context, messages []OpenRouterMessage) (io.ReadCloser, error) {
+	return doChatCompletionStream(ctx, p.Name(), p.endpoint, p.model, messages, p.headers)
+}
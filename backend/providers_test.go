@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeProvider is a minimal LLMProvider stand-in for exercising fallback
+// ordering without making real network calls.
+type fakeProvider struct {
+	name  string
+	err   error
+	text  string
+	calls int
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) Complete(ctx context.Context, messages []OpenRouterMessage) (string, error) {
+	p.calls++
+	if p.err != nil {
+		return "", p.err
+	}
+	return p.text, nil
+}
+
+func (p *fakeProvider) Stream(ctx context.Context, messages []OpenRouterMessage) (io.ReadCloser, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return io.NopCloser(nil), nil
+}
+
+// withRegistry swaps the package-level provider registry/fallback chain
+// for the duration of a test and restores the originals afterward.
+func withRegistry(t *testing.T, registry map[string]LLMProvider, chain []string) {
+	t.Helper()
+	origRegistry, origChain := providerRegistry, providerFallbackChain
+	providerRegistry, providerFallbackChain = registry, chain
+	t.Cleanup(func() {
+		providerRegistry, providerFallbackChain = origRegistry, origChain
+	})
+}
+
+func TestSelectProviderChainPrefersExplicitRequest(t *testing.T) {
+	withRegistry(t, map[string]LLMProvider{
+		"openrouter": &fakeProvider{name: "openrouter"},
+		"openai":     &fakeProvider{name: "openai"},
+		"anthropic":  &fakeProvider{name: "anthropic"},
+	}, []string{"openrouter", "openai", "anthropic"})
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/route?provider=anthropic", nil)
+	chain := selectProviderChain(r)
+
+	if len(chain) != 3 {
+		t.Fatalf("expected 3 providers in chain, got %d", len(chain))
+	}
+	if chain[0].Name() != "anthropic" {
+		t.Fatalf("expected explicitly requested provider first, got %q", chain[0].Name())
+	}
+	if chain[1].Name() != "openrouter" || chain[2].Name() != "openai" {
+		t.Fatalf("expected fallback chain order preserved after the requested provider, got %v", namesOf(chain))
+	}
+}
+
+func TestSelectProviderChainHeaderAndDedup(t *testing.T) {
+	withRegistry(t, map[string]LLMProvider{
+		"openrouter": &fakeProvider{name: "openrouter"},
+		"openai":     &fakeProvider{name: "openai"},
+	}, []string{"openrouter", "openai"})
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/route", nil)
+	r.Header.Set("X-LLM-Provider", "openrouter")
+	chain := selectProviderChain(r)
+
+	if len(chain) != 2 {
+		t.Fatalf("expected the requested provider not to be duplicated, got %d entries: %v", len(chain), namesOf(chain))
+	}
+	if chain[0].Name() != "openrouter" || chain[1].Name() != "openai" {
+		t.Fatalf("unexpected chain order: %v", namesOf(chain))
+	}
+}
+
+func TestCompleteWithFallbackTriesNextOnError(t *testing.T) {
+	chain := []LLMProvider{
+		&fakeProvider{name: "openrouter", err: errors.New("regional outage")},
+		&fakeProvider{name: "openai", text: "fallback response"},
+	}
+
+	text, err := completeWithFallback(context.Background(), chain, nil)
+	if err != nil {
+		t.Fatalf("expected fallback to succeed, got error: %v", err)
+	}
+	if text != "fallback response" {
+		t.Fatalf("expected response from the second provider, got %q", text)
+	}
+}
+
+func TestCompleteWithFallbackAllFail(t *testing.T) {
+	chain := []LLMProvider{
+		&fakeProvider{name: "openrouter", err: errors.New("down")},
+		&fakeProvider{name: "openai", err: errors.New("also down")},
+	}
+
+	if _, err := completeWithFallback(context.Background(), chain, nil); err == nil {
+		t.Fatal("expected an error when every provider in the chain fails")
+	}
+}
+
+// TestCompleteWithFallbackStopsOnContextCancellation guards against
+// reintroducing the wasted-LLM-spend-after-disconnect bug chunk0-5 fixed:
+// once the caller's context is canceled, the loop must not burn through
+// the rest of the chain.
+func TestCompleteWithFallbackStopsOnContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	openai := &fakeProvider{name: "openai", text: "should never be reached"}
+	chain := []LLMProvider{
+		&fakeProvider{name: "openrouter", err: func() error { cancel(); return context.Canceled }()},
+		openai,
+	}
+
+	_, err := completeWithFallback(ctx, chain, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if openai.calls != 0 {
+		t.Fatalf("expected the fallback chain to stop after cancellation, but openai was called %d time(s)", openai.calls)
+	}
+}
+
+func TestStreamWithFallbackStopsOnContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	openai := &fakeProvider{name: "openai"}
+	chain := []LLMProvider{
+		&fakeProvider{name: "openrouter", err: func() error { cancel(); return context.Canceled }()},
+		openai,
+	}
+
+	_, _, err := streamWithFallback(ctx, chain, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if openai.calls != 0 {
+		t.Fatalf("expected the fallback chain to stop after cancellation, but openai was called %d time(s)", openai.calls)
+	}
+}
+
+func namesOf(chain []LLMProvider) []string {
+	names := make([]string, len(chain))
+	for i, p := range chain {
+		names[i] = p.Name()
+	}
+	return names
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// --- STREAMING SSE SHAPES ---
+
+// WarningResponse is emitted as an `event: warning` when the assembled
+// plan violates a server-side constraint (currently just budget) but is
+// otherwise well-formed enough to show the client.
+type WarningResponse struct {
+	Warning string             `json:"warning"`
+	Plan    TravelPlanResponse `json:"plan"`
+}
+
+// budgetTolerance allows the AI's day-by-day estimate to overshoot the
+// requested budget a little before we flag it — LLM arithmetic is rarely
+// exact to the rupee.
+const budgetTolerance = 0.05 // 5%
+
+// planStreamAccumulator turns the raw `delta.content` fragments of an
+// OpenRouter SSE stream into complete per-day SSE events, emitting each
+// DayPlan the moment its JSON object closes instead of waiting for the
+// whole response.
+//
+// A DayPlan never sits at the top level of the response — it's always an
+// element of the outer envelope's "days" array — so finding "complete
+// objects" can't just balance braces from the start of the buffer; that
+// only ever closes once the whole envelope does. Each feed re-parses the
+// buffer with json.Decoder, fast-forwards past the envelope's other
+// fields to the "days" array, and decodes as many array elements as are
+// currently complete.
+type planStreamAccumulator struct {
+	raw         strings.Builder
+	emittedDays int
+}
+
+// feed appends a content fragment and returns any newly-completed
+// DayPlan objects found in the "days" array so far.
+func (a *planStreamAccumulator) feed(fragment string) []DayPlan {
+	a.raw.WriteString(fragment)
+
+	days := extractDayObjects(trimJSONFence(a.raw.String()))
+	if len(days) <= a.emittedDays {
+		return nil
+	}
+
+	newDays := days[a.emittedDays:]
+	a.emittedDays = len(days)
+	return newDays
+}
+
+// finalize parses the full accumulated response and validates it against
+// the requested budget.
+func (a *planStreamAccumulator) finalize() (TravelPlanResponse, error) {
+	text := trimJSONFence(a.raw.String())
+
+	var plan TravelPlanResponse
+	if err := json.Unmarshal([]byte(text), &plan); err != nil {
+		return plan, fmt.Errorf("failed to parse assembled plan: %w", err)
+	}
+	return plan, nil
+}
+
+// trimJSONFence strips an optional ```json / ``` code-fence wrapper the
+// model sometimes adds despite being told to respond with raw JSON. Safe
+// to call on a still-growing buffer: the fence markers only ever appear
+// at the very start and end, so a trailing fence that hasn't arrived yet
+// simply isn't trimmed until it does.
+func trimJSONFence(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "```json")
+	s = strings.TrimPrefix(s, "```")
+	s = strings.TrimSuffix(s, "```")
+	return strings.TrimSpace(s)
+}
+
+// extractDayObjects decodes as many elements of the envelope's "days"
+// array as are currently complete in s, returning whatever was
+// successfully decoded and stopping silently at the first incomplete or
+// not-yet-arrived element so the caller can retry once more data lands.
+func extractDayObjects(s string) []DayPlan {
+	dec := json.NewDecoder(strings.NewReader(s))
+	if !seekToDaysArray(dec) {
+		return nil
+	}
+
+	var days []DayPlan
+	for dec.More() {
+		var day DayPlan
+		if err := dec.Decode(&day); err != nil {
+			break
+		}
+		days = append(days, day)
+	}
+	return days
+}
+
+// seekToDaysArray advances dec past the envelope's opening brace and
+// every field before "days", discarding each value generically via
+// json.RawMessage so field order in the model's output doesn't matter.
+// It returns false if the buffer doesn't yet contain a complete path to
+// the array's opening bracket.
+func seekToDaysArray(dec *json.Decoder) bool {
+	tok, err := dec.Token()
+	if err != nil {
+		return false
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return false
+	}
+
+	for dec.More() {
+		keyTok, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		if key, _ := keyTok.(string); key == "days" {
+			delim, err := dec.Token()
+			if err != nil {
+				return false
+			}
+			d, ok := delim.(json.Delim)
+			return ok && d == '['
+		}
+
+		var discarded json.RawMessage
+		if err := dec.Decode(&discarded); err != nil {
+			return false
+		}
+	}
+	return false
+}
+
+// budgetExceeds reports whether the sum of every day's expenses exceeds
+// the requested budget by more than the configured tolerance.
+func budgetExceeds(plan TravelPlanResponse) (float64, bool) {
+	var total float64
+	for _, day := range plan.Days {
+		for _, amount := range day.Expenses {
+			total += amount
+		}
+	}
+	if plan.Budget <= 0 {
+		return total, false
+	}
+	return total, total > plan.Budget*(1+budgetTolerance)
+}
+
+// --- SSE WRITE HELPERS ---
+
+func writeSSEEvent(w http.ResponseWriter, flusher http.Flusher, event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		payload = []byte(fmt.Sprintf(`{"error":%q}`, err.Error()))
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	flusher.Flush()
+}
+
+// extractDeltaContent pulls `choices[0].delta.content` out of one
+// OpenRouter streaming chunk, the way the SDKs do, ignoring chunks that
+// don't carry any content (e.g. the opening role-only chunk).
+func extractDeltaContent(chunkJSON string) string {
+	var chunk struct {
+		Choices []struct {
+			Delta struct {
+				Content string `json:"content"`
+			} `json:"delta"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal([]byte(chunkJSON), &chunk); err != nil {
+		return ""
+	}
+	if len(chunk.Choices) == 0 {
+		return ""
+	}
+	return chunk.Choices[0].Delta.Content
+}
@@ -0,0 +1,88 @@
+package main
+
+import "testing"
+
+// chunk splits s into pieces of at most n runes, simulating how a real
+// SSE stream delivers a response a few tokens at a time rather than all
+// at once.
+func chunk(s string, n int) []string {
+	var chunks []string
+	runes := []rune(s)
+	for i := 0; i < len(runes); i += n {
+		end := i + n
+		if end > len(runes) {
+			end = len(runes)
+		}
+		chunks = append(chunks, string(runes[i:end]))
+	}
+	return chunks
+}
+
+func TestPlanStreamAccumulatorEmitsDaysIncrementally(t *testing.T) {
+	full := `{"source":"Mumbai","destination":"Goa","budget":15000,` +
+		`"days":[` +
+		`{"day":1,"activities":"Beach day","expenses":{"food":500,"transport":100}},` +
+		`{"day":2,"activities":"Sightseeing","expenses":{"food":600,"tickets":300}},` +
+		`{"day":3,"activities":"Markets","expenses":{"food":400,"shopping":1200}}` +
+		`]}`
+
+	var acc planStreamAccumulator
+	var emitted []DayPlan
+	var emittedBeforeFinalChunk int
+
+	chunks := chunk(full, 13)
+	for i, c := range chunks {
+		days := acc.feed(c)
+		emitted = append(emitted, days...)
+		if i < len(chunks)-1 && len(emitted) > 0 {
+			emittedBeforeFinalChunk = len(emitted)
+		}
+	}
+
+	if len(emitted) != 3 {
+		t.Fatalf("expected 3 incremental day events, got %d: %+v", len(emitted), emitted)
+	}
+	if emittedBeforeFinalChunk == 0 {
+		t.Fatal("expected at least one day to be emitted before the stream finished, got none until the last chunk")
+	}
+	for i, day := range emitted {
+		if day.Day != i+1 {
+			t.Fatalf("expected day %d at position %d, got %+v", i+1, i, day)
+		}
+	}
+
+	plan, err := acc.finalize()
+	if err != nil {
+		t.Fatalf("finalize failed: %v", err)
+	}
+	if plan.Source != "Mumbai" || plan.Destination != "Goa" || plan.Budget != 15000 {
+		t.Fatalf("unexpected envelope fields: %+v", plan)
+	}
+	if len(plan.Days) != 3 {
+		t.Fatalf("expected 3 days in the finalized plan, got %d", len(plan.Days))
+	}
+}
+
+func TestPlanStreamAccumulatorHandlesCodeFence(t *testing.T) {
+	full := "```json\n" +
+		`{"source":"Delhi","destination":"Jaipur","budget":8000,"days":[{"day":1,"activities":"Fort","expenses":{"food":200}}]}` +
+		"\n```"
+
+	var acc planStreamAccumulator
+	var emitted []DayPlan
+	for _, c := range chunk(full, 9) {
+		emitted = append(emitted, acc.feed(c)...)
+	}
+
+	if len(emitted) != 1 || emitted[0].Day != 1 {
+		t.Fatalf("expected exactly one day-1 event, got %+v", emitted)
+	}
+
+	plan, err := acc.finalize()
+	if err != nil {
+		t.Fatalf("finalize failed: %v", err)
+	}
+	if plan.Source != "Delhi" {
+		t.Fatalf("unexpected source after fence trimming: %q", plan.Source)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// --- OPENTELEMETRY TRACING ---
+//
+// Every LLM call gets its own span so a slow or failing request can be
+// traced end-to-end through whichever provider answered it, with the
+// trace context propagated into the outgoing request so the upstream
+// (when it supports it) shows up in the same trace.
+
+const tracerName = "travelplanner"
+
+var tracer = otel.Tracer(tracerName)
+
+// initTracing wires up an OTLP/HTTP span exporter when
+// OTEL_EXPORTER_OTLP_ENDPOINT is configured, and returns a shutdown func
+// to flush pending spans on graceful shutdown. With no endpoint set, it
+// installs a no-op provider so span creation stays cheap and safe.
+func initTracing(ctx context.Context) func(context.Context) error {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	if endpoint == "" {
+		log.Println("⚠️  OTEL_EXPORTER_OTLP_ENDPOINT not set, tracing is disabled")
+		return func(context.Context) error { return nil }
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		log.Printf("🚨 Failed to create OTLP exporter, tracing is disabled: %v", err)
+		return func(context.Context) error { return nil }
+	}
+
+	res, err := sdkresource.New(ctx,
+		sdkresource.WithAttributes(semconv.ServiceName("travelplanner")),
+	)
+	if err != nil {
+		res = sdkresource.Default()
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return tp.Shutdown
+}
+
+// startLLMSpan opens a span for one Complete/Stream call with the
+// attributes every provider can fill in up front; callers add
+// llm.prompt_tokens/llm.completion_tokens once the response comes back.
+func startLLMSpan(ctx context.Context, provider, model string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "llm.call", trace.WithAttributes(
+		attribute.String("llm.provider", provider),
+		attribute.String("llm.model", model),
+	))
+}
+
+// recordSpanUsage annotates span with token counts once the provider's
+// response has been parsed.
+func recordSpanUsage(span trace.Span, usage *openRouterUsage) {
+	if usage == nil {
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("llm.prompt_tokens", usage.PromptTokens),
+		attribute.Int("llm.completion_tokens", usage.CompletionTokens),
+	)
+}
+
+// injectTraceparent propagates the active span context into the outgoing
+// provider request so a provider that forwards headers keeps the trace
+// connected end-to-end.
+func injectTraceparent(ctx context.Context, req *http.Request) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+}